@@ -0,0 +1,77 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/algoadv/etcd/pkg/types"
+	"github.com/algoadv/etcd/raftgrpc"
+	"github.com/algoadv/etcd/rafthttp"
+)
+
+// PeerTransportKind selects which wire protocol EtcdServer uses to
+// exchange raft messages with other members.
+type PeerTransportKind string
+
+const (
+	// PeerTransportHTTP is the default, rafthttp-based transport.
+	PeerTransportHTTP PeerTransportKind = "http"
+	// PeerTransportGRPC uses raftgrpc instead of rafthttp.
+	PeerTransportGRPC PeerTransportKind = "grpc"
+)
+
+// PeerTransport is the subset of rafthttp.Transport's and raftgrpc.Transport's
+// surface startPeerTransport's caller needs to manage cluster membership as
+// raft's Ready() loop adds and removes members, once the rest of EtcdServer's
+// startup exists to drive it: both Transports' AddPeer/RemovePeer/UpdatePeer
+// now take peer URLs, so the caller can treat either kind identically.
+// Send/SendSnapshot/Stop are deliberately not part of this interface:
+// rafthttp.Transport does not implement them (its production peer lifecycle
+// is out of scope here, see rafthttp/transport.go), so claiming a shared
+// surface for them would be aspirational rather than real.
+type PeerTransport interface {
+	AddPeer(id types.ID, us []string)
+	RemovePeer(id types.ID)
+	UpdatePeer(id types.ID, us []string)
+}
+
+// startPeerTransport builds and, where the transport owns its own listener,
+// starts the peer transport EtcdServer was configured to use, returning the
+// transport itself so the caller can retain it for AddPeer/RemovePeer calls
+// as members join and leave.
+//
+// rafthttp shares the member's existing peer http.Server, so for
+// PeerTransportHTTP the caller is expected to mount the returned handler on
+// that server's mux; raftgrpc's grpc.Server cannot share a plain net/http
+// mux, so for PeerTransportGRPC it is started on peerListener directly and a
+// nil handler is returned.
+func startPeerTransport(kind PeerTransportKind, id, cid types.ID, r rafthttp.Raft, snapSaver rafthttp.SnapshotSaver, peerListener net.Listener) (PeerTransport, http.Handler, error) {
+	switch kind {
+	case PeerTransportHTTP, "":
+		tr := rafthttp.NewTransport(id, cid, r, snapSaver)
+		return tr, tr.Handler(), nil
+	case PeerTransportGRPC:
+		tr := raftgrpc.NewTransport(id, cid, r, snapSaver)
+		if err := tr.Start(peerListener); err != nil {
+			return nil, nil, err
+		}
+		return tr, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("etcdserver: unknown peer transport %q", kind)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcdserver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/algoadv/etcd/raftgrpc"
+	"github.com/algoadv/etcd/rafthttp"
+)
+
+func TestStartPeerTransportUnknownKind(t *testing.T) {
+	_, _, err := startPeerTransport(PeerTransportKind("carrier-pigeon"), 1, 1, nil, nil, nil)
+	if err == nil {
+		t.Fatal("expected an error for an unknown peer transport kind, got nil")
+	}
+}
+
+func TestStartPeerTransportHTTP(t *testing.T) {
+	tr, h, err := startPeerTransport(PeerTransportHTTP, 1, 1, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("startPeerTransport returned error: %v", err)
+	}
+	if tr == nil {
+		t.Fatal("expected a non-nil transport so the caller can AddPeer/RemovePeer later")
+	}
+	if h == nil {
+		t.Fatal("expected a non-nil http.Handler to mount for the HTTP transport")
+	}
+	if _, ok := tr.(*rafthttp.Transport); !ok {
+		t.Fatalf("transport = %T, want *rafthttp.Transport", tr)
+	}
+}
+
+func TestStartPeerTransportGRPC(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	tr, h, err := startPeerTransport(PeerTransportGRPC, 1, 1, nil, nil, l)
+	if err != nil {
+		t.Fatalf("startPeerTransport returned error: %v", err)
+	}
+	if tr == nil {
+		t.Fatal("expected a non-nil transport so the caller can AddPeer/RemovePeer later")
+	}
+	if h != nil {
+		t.Fatal("expected a nil http.Handler for the gRPC transport, which serves peerListener directly")
+	}
+	gt, ok := tr.(*raftgrpc.Transport)
+	if !ok {
+		t.Fatalf("transport = %T, want *raftgrpc.Transport", tr)
+	}
+	gt.Stop()
+}
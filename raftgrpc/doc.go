@@ -0,0 +1,35 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package raftgrpc implements a gRPC based alternative to rafthttp for
+// sending and receiving raft messages between members of an etcd cluster.
+//
+// It mirrors the wire-level responsibilities of rafthttp (the
+// Transporter/Peer/SnapshotSaver contracts) but replaces the hand-rolled
+// HTTP framing with a generated gRPC service:
+//
+//   - Send is a unary RPC used for one-off raft messages (heartbeats,
+//     votes, ...), replacing POSTs to RaftPrefix.
+//   - Stream is a server-streaming RPC used for the long-lived per-peer
+//     message pipe, replacing the streamTypeMsgAppV2/streamTypeMessage
+//     connections opened against RaftStreamPrefix.
+//   - SendSnapshot is a client-streaming RPC that chunks a snapshot across
+//     multiple messages instead of relying on a single long-lived POST
+//     body, replacing RaftSnapshotPrefix.
+//
+// The cluster ID and minimum cluster version checks that rafthttp performs
+// per-request via checkClusterCompatibilityFromHeader are performed once per
+// RPC by the interceptors in interceptor.go; the caller's own server version
+// is not checked.
+package raftgrpc
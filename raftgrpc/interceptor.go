@@ -0,0 +1,118 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raftgrpc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/algoadv/etcd/Godeps/_workspace/src/github.com/coreos/go-semver/semver"
+	"github.com/algoadv/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/algoadv/etcd/Godeps/_workspace/src/google.golang.org/grpc"
+	"github.com/algoadv/etcd/Godeps/_workspace/src/google.golang.org/grpc/codes"
+	"github.com/algoadv/etcd/Godeps/_workspace/src/google.golang.org/grpc/metadata"
+	"github.com/algoadv/etcd/pkg/types"
+	"github.com/algoadv/etcd/version"
+)
+
+// Metadata keys carried on every RaftTransport RPC. They are the gRPC
+// equivalents of the X-Server-From/X-Server-Version/X-Min-Cluster-Version/
+// X-Etcd-Cluster-ID headers checked per-request by
+// checkClusterCompatibilityFromHeader in rafthttp.
+const (
+	metaServerFromKey        = "server-from"
+	metaServerVersionKey     = "server-version"
+	metaMinClusterVersionKey = "min-cluster-version"
+	metaClusterIDKey         = "etcd-cluster-id"
+)
+
+var (
+	errIncompatibleVersion = errors.New("raftgrpc: incompatible version")
+	errClusterIDMismatch   = errors.New("raftgrpc: cluster ID mismatch")
+)
+
+// newClusterCompatibilityChecker returns the unary and stream server
+// interceptors that reject an RPC before it reaches the RaftTransportServer
+// implementation if this member's version is lower than the minimum cluster
+// version the caller advertises, or if the caller's cluster ID differs from
+// cid. Unlike checkClusterCompatibilityFromHeader, they do not check the
+// caller's own server version.
+func newClusterCompatibilityChecker(cid types.ID) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	c := &compatChecker{cid: cid}
+	return c.unary, c.stream
+}
+
+type compatChecker struct {
+	cid types.ID
+}
+
+func (c *compatChecker) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := c.check(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (c *compatChecker) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := c.check(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func (c *compatChecker) check(ctx context.Context) error {
+	md, ok := metadata.FromContext(ctx)
+	if !ok {
+		return grpc.Errorf(codes.InvalidArgument, "raftgrpc: missing metadata")
+	}
+	if err := checkMinClusterVersion(first(md[metaMinClusterVersionKey])); err != nil {
+		plog.Errorf("request version incompatibility (%v)", err)
+		return grpc.Errorf(codes.FailedPrecondition, errIncompatibleVersion.Error())
+	}
+	if gcid := first(md[metaClusterIDKey]); gcid != c.cid.String() {
+		plog.Errorf("request cluster ID mismatch (got %s want %s)", gcid, c.cid)
+		return grpc.Errorf(codes.FailedPrecondition, errClusterIDMismatch.Error())
+	}
+	return nil
+}
+
+func first(vals []string) string {
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[0]
+}
+
+// checkMinClusterVersion verifies that this member's version is not older
+// than the minimum cluster version the caller advertises. An empty
+// minClusterVersion means the caller does not know its cluster's minimum
+// version yet (e.g. during bootstrap), in which case the check is skipped.
+func checkMinClusterVersion(minClusterVersion string) error {
+	if minClusterVersion == "" {
+		return nil
+	}
+	lv, err := semver.NewVersion(version.Version)
+	if err != nil {
+		return err
+	}
+	minV, err := semver.NewVersion(minClusterVersion)
+	if err != nil {
+		return fmt.Errorf("could not parse min cluster version %q: %v", minClusterVersion, err)
+	}
+	if lv.LessThan(*minV) {
+		return fmt.Errorf("local server version %s is lower than min cluster version %s", lv, minV)
+	}
+	return nil
+}
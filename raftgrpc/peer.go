@@ -0,0 +1,288 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raftgrpc
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/algoadv/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/algoadv/etcd/Godeps/_workspace/src/google.golang.org/grpc"
+	"github.com/algoadv/etcd/Godeps/_workspace/src/google.golang.org/grpc/metadata"
+	"github.com/algoadv/etcd/pkg/types"
+	"github.com/algoadv/etcd/raft/raftpb"
+	"github.com/algoadv/etcd/snap"
+	"github.com/algoadv/etcd/version"
+)
+
+// snapshotChunkSize is the amount of snapshot payload carried by a single
+// SnapshotChunk. It bounds how long a stalled SendSnapshot call can go
+// without the sender or receiver noticing the other side is gone, unlike
+// the single long-lived POST body rafthttp relies on TCP keepalive for.
+const snapshotChunkSize = 32 * 1024
+
+// peer is the gRPC counterpart of rafthttp's peer: it owns the connection
+// to one remote member and is the unit AddPeer/RemovePeer operate on.
+type peer struct {
+	tr *Transport
+	id types.ID
+
+	cc     *grpc.ClientConn
+	client RaftTransportClient
+
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	urls       []string
+	stream     RaftTransport_StreamServer
+	streamDone chan struct{}
+	since      time.Time
+}
+
+func startPeer(tr *Transport, id types.ID, us []string) *peer {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &peer{tr: tr, id: id, urls: us, cancel: cancel}
+	p.dial(us)
+	go p.runStreamReader(ctx)
+	return p
+}
+
+func (p *peer) dial(us []string) {
+	if len(us) == 0 {
+		plog.Errorf("failed to dial peer %s (no peer URLs configured)", p.id)
+		return
+	}
+	// TODO(raftgrpc): pick a live URL the way rafthttp's urlPicker does
+	// instead of always using the first one.
+	cc, err := grpc.Dial(us[0], grpc.WithInsecure())
+	if err != nil {
+		plog.Errorf("failed to dial peer %s at %s (%v)", p.id, us[0], err)
+		return
+	}
+	p.mu.Lock()
+	p.cc = cc
+	p.client = NewRaftTransportClient(cc)
+	p.mu.Unlock()
+}
+
+func (p *peer) outgoingContext(ctx context.Context) context.Context {
+	md := metadata.Pairs(
+		metaServerFromKey, p.tr.ID.String(),
+		metaServerVersionKey, version.Version,
+		metaMinClusterVersionKey, version.MinClusterVersion,
+		metaClusterIDKey, p.tr.ClusterID.String(),
+	)
+	return metadata.NewContext(ctx, md)
+}
+
+// runStreamReader dials the remote's Stream RPC to receive the messages it
+// pushes to us, redialing with a backoff if the stream ever ends. This
+// replaces rafthttp's streamReader.
+func (p *peer) runStreamReader(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		p.mu.Lock()
+		client := p.client
+		p.mu.Unlock()
+		if client == nil {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		req := &StreamRequest{From: uint64(p.tr.ID), To: uint64(p.id), ClusterID: uint64(p.tr.ClusterID)}
+		sc, err := client.Stream(p.outgoingContext(ctx), req)
+		if err != nil {
+			plog.Warningf("failed to establish stream to peer %s (%v)", p.id, err)
+			time.Sleep(time.Second)
+			continue
+		}
+		p.mu.Lock()
+		if p.since.IsZero() {
+			p.since = time.Now()
+		}
+		p.mu.Unlock()
+		for {
+			m, err := sc.Recv()
+			if err != nil {
+				plog.Warningf("lost stream from peer %s (%v)", p.id, err)
+				break
+			}
+			if err := p.tr.Raft.Process(ctx, *m); err != nil {
+				plog.Warningf("failed to process raft message from %s (%v)", p.id, err)
+			}
+		}
+	}
+}
+
+// attachStream records the server-side stream a remote opened to receive
+// our pushes, and returns a channel that closes once the stream ends.
+func (p *peer) attachStream(stream RaftTransport_StreamServer) <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.streamDone != nil {
+		// end the stream this one supersedes
+		close(p.streamDone)
+	}
+	p.stream = stream
+	p.streamDone = make(chan struct{})
+	if p.since.IsZero() {
+		p.since = time.Now()
+	}
+	done := p.streamDone
+	go func() {
+		<-stream.Context().Done()
+		p.detachStream(stream)
+	}()
+	return done
+}
+
+func (p *peer) detachStream(stream RaftTransport_StreamServer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stream == stream {
+		p.stream = nil
+		close(p.streamDone)
+		p.streamDone = nil
+	}
+}
+
+// send pushes m to the peer, preferring the attached stream and falling
+// back to a unary Send when no stream has been established yet.
+func (p *peer) send(m raftpb.Message) {
+	p.mu.Lock()
+	stream := p.stream
+	client := p.client
+	p.mu.Unlock()
+
+	if stream != nil {
+		if err := stream.Send(&m); err == nil {
+			return
+		}
+		plog.Warningf("failed to push raft message to peer %s over stream, falling back to unary send", p.id)
+	}
+	if client == nil {
+		plog.Debugf("dropped message %s to peer %s (not yet connected)", m.Type, p.id)
+		return
+	}
+	go func(m raftpb.Message) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := client.Send(p.outgoingContext(ctx), &m); err != nil {
+			plog.Warningf("failed to send raft message to peer %s (%v)", p.id, err)
+		}
+	}(m)
+}
+
+// sendSnap streams m to the peer in bounded chunks.
+func (p *peer) sendSnap(m snap.Message) {
+	go func() {
+		defer m.CloseWithError(nil)
+
+		p.mu.Lock()
+		client := p.client
+		p.mu.Unlock()
+		if client == nil {
+			m.CloseWithError(errMemberNotFound)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		sc, err := client.SendSnapshot(p.outgoingContext(ctx))
+		if err != nil {
+			plog.Errorf("failed to open snapshot stream to peer %s (%v)", p.id, err)
+			m.CloseWithError(err)
+			return
+		}
+
+		envelope, err := m.Message.Marshal()
+		if err != nil {
+			m.CloseWithError(err)
+			return
+		}
+
+		buf := make([]byte, snapshotChunkSize)
+		first := true
+		var seq uint64
+		for {
+			n, rerr := m.ReadCloser.Read(buf)
+			if rerr != nil && rerr != io.EOF {
+				plog.Errorf("failed to read snapshot for peer %s (%v)", p.id, rerr)
+				m.CloseWithError(rerr)
+				return
+			}
+			last := rerr == io.EOF
+			chunk := &SnapshotChunk{
+				From:      uint64(p.tr.ID),
+				To:        uint64(p.id),
+				ClusterID: uint64(p.tr.ClusterID),
+				Seq:       seq,
+				Data:      buf[:n],
+				Last:      last,
+			}
+			if first {
+				chunk.Message = envelope
+				first = false
+			}
+			if n > 0 || last {
+				if err := sc.Send(chunk); err != nil {
+					plog.Errorf("failed to send snapshot chunk to peer %s (%v)", p.id, err)
+					m.CloseWithError(err)
+					return
+				}
+				seq++
+			}
+			if last {
+				break
+			}
+		}
+		if _, err := sc.CloseAndRecv(); err != nil {
+			plog.Errorf("failed to complete snapshot transfer to peer %s (%v)", p.id, err)
+			m.CloseWithError(err)
+		}
+	}()
+}
+
+func (p *peer) update(us []string) {
+	p.mu.Lock()
+	p.urls = us
+	old := p.cc
+	p.mu.Unlock()
+	p.dial(us)
+	if old != nil {
+		old.Close()
+	}
+}
+
+func (p *peer) activeSince() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.since
+}
+
+func (p *peer) stop() {
+	p.cancel()
+	p.mu.Lock()
+	cc := p.cc
+	p.mu.Unlock()
+	if cc != nil {
+		cc.Close()
+	}
+}
@@ -0,0 +1,276 @@
+// Code generated by protoc-gen-gogo.
+// source: rafttransport.proto
+// DO NOT EDIT!
+
+package raftgrpc
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/algoadv/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/algoadv/etcd/Godeps/_workspace/src/google.golang.org/grpc"
+	"github.com/algoadv/etcd/raft/raftpb"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = math.Inf
+
+type StreamType int32
+
+const (
+	StreamType_MSGAPP_V2 StreamType = 0
+	StreamType_MESSAGE   StreamType = 1
+)
+
+var StreamType_name = map[int32]string{
+	0: "MSGAPP_V2",
+	1: "MESSAGE",
+}
+var StreamType_value = map[string]int32{
+	"MSGAPP_V2": 0,
+	"MESSAGE":   1,
+}
+
+func (x StreamType) String() string {
+	return StreamType_name[int32(x)]
+}
+
+type StreamRequest struct {
+	From      uint64     `protobuf:"varint,1,opt,name=from" json:"from"`
+	To        uint64     `protobuf:"varint,2,opt,name=to" json:"to"`
+	ClusterID uint64     `protobuf:"varint,3,opt,name=cluster_id" json:"cluster_id"`
+	Term      string     `protobuf:"bytes,4,opt,name=term" json:"term"`
+	Type      StreamType `protobuf:"varint,5,opt,name=type,enum=raftgrpc.StreamType" json:"type"`
+}
+
+func (m *StreamRequest) Reset()         { *m = StreamRequest{} }
+func (m *StreamRequest) String() string { return fmt.Sprintf("%+v", *m) }
+func (*StreamRequest) ProtoMessage()    {}
+
+type SendResponse struct{}
+
+func (m *SendResponse) Reset()         { *m = SendResponse{} }
+func (m *SendResponse) String() string { return "SendResponse{}" }
+func (*SendResponse) ProtoMessage()    {}
+
+// SnapshotChunk carries one piece of a chunked snapshot transfer. The first
+// chunk (Seq == 0) carries the raft message envelope in Message; Data may
+// be set on any chunk, including the first.
+type SnapshotChunk struct {
+	From      uint64 `protobuf:"varint,1,opt,name=from" json:"from"`
+	To        uint64 `protobuf:"varint,2,opt,name=to" json:"to"`
+	ClusterID uint64 `protobuf:"varint,3,opt,name=cluster_id" json:"cluster_id"`
+	Seq       uint64 `protobuf:"varint,4,opt,name=seq" json:"seq"`
+	Last      bool   `protobuf:"varint,5,opt,name=last" json:"last"`
+	Message   []byte `protobuf:"bytes,6,opt,name=message" json:"message,omitempty"`
+	Data      []byte `protobuf:"bytes,7,opt,name=data" json:"data,omitempty"`
+}
+
+func (m *SnapshotChunk) Reset()         { *m = SnapshotChunk{} }
+func (m *SnapshotChunk) String() string { return fmt.Sprintf("%+v", *m) }
+func (*SnapshotChunk) ProtoMessage()    {}
+
+type SnapshotResponse struct {
+	BytesReceived uint64 `protobuf:"varint,1,opt,name=bytes_received" json:"bytes_received"`
+}
+
+func (m *SnapshotResponse) Reset()         { *m = SnapshotResponse{} }
+func (m *SnapshotResponse) String() string { return fmt.Sprintf("%+v", *m) }
+func (*SnapshotResponse) ProtoMessage()    {}
+
+// Client API for RaftTransport service
+
+type RaftTransportClient interface {
+	Send(ctx context.Context, in *raftpb.Message, opts ...grpc.CallOption) (*SendResponse, error)
+	Stream(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (RaftTransport_StreamClient, error)
+	SendSnapshot(ctx context.Context, opts ...grpc.CallOption) (RaftTransport_SendSnapshotClient, error)
+}
+
+type raftTransportClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewRaftTransportClient(cc *grpc.ClientConn) RaftTransportClient {
+	return &raftTransportClient{cc}
+}
+
+func (c *raftTransportClient) Send(ctx context.Context, in *raftpb.Message, opts ...grpc.CallOption) (*SendResponse, error) {
+	out := new(SendResponse)
+	err := grpc.Invoke(ctx, "/raftgrpc.RaftTransport/Send", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type RaftTransport_StreamClient interface {
+	Recv() (*raftpb.Message, error)
+	grpc.ClientStream
+}
+
+func (c *raftTransportClient) Stream(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (RaftTransport_StreamClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_RaftTransport_serviceDesc.Streams[0], c.cc, "/raftgrpc.RaftTransport/Stream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &raftTransportStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type raftTransportStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *raftTransportStreamClient) Recv() (*raftpb.Message, error) {
+	m := new(raftpb.Message)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+type RaftTransport_SendSnapshotClient interface {
+	Send(*SnapshotChunk) error
+	CloseAndRecv() (*SnapshotResponse, error)
+	grpc.ClientStream
+}
+
+func (c *raftTransportClient) SendSnapshot(ctx context.Context, opts ...grpc.CallOption) (RaftTransport_SendSnapshotClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_RaftTransport_serviceDesc.Streams[1], c.cc, "/raftgrpc.RaftTransport/SendSnapshot", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &raftTransportSendSnapshotClient{stream}
+	return x, nil
+}
+
+type raftTransportSendSnapshotClient struct {
+	grpc.ClientStream
+}
+
+func (x *raftTransportSendSnapshotClient) Send(m *SnapshotChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *raftTransportSendSnapshotClient) CloseAndRecv() (*SnapshotResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(SnapshotResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for RaftTransport service
+
+type RaftTransportServer interface {
+	Send(context.Context, *raftpb.Message) (*SendResponse, error)
+	Stream(*StreamRequest, RaftTransport_StreamServer) error
+	SendSnapshot(RaftTransport_SendSnapshotServer) error
+}
+
+func RegisterRaftTransportServer(s *grpc.Server, srv RaftTransportServer) {
+	s.RegisterService(&_RaftTransport_serviceDesc, srv)
+}
+
+func _RaftTransport_Send_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(raftpb.Message)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RaftTransportServer).Send(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/raftgrpc.RaftTransport/Send",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RaftTransportServer).Send(ctx, req.(*raftpb.Message))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+type RaftTransport_StreamServer interface {
+	Send(*raftpb.Message) error
+	grpc.ServerStream
+}
+
+func _RaftTransport_Stream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RaftTransportServer).Stream(m, &raftTransportStreamServer{stream})
+}
+
+type raftTransportStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *raftTransportStreamServer) Send(m *raftpb.Message) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+type RaftTransport_SendSnapshotServer interface {
+	SendAndClose(*SnapshotResponse) error
+	Recv() (*SnapshotChunk, error)
+	grpc.ServerStream
+}
+
+func _RaftTransport_SendSnapshot_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RaftTransportServer).SendSnapshot(&raftTransportSendSnapshotServer{stream})
+}
+
+type raftTransportSendSnapshotServer struct {
+	grpc.ServerStream
+}
+
+func (x *raftTransportSendSnapshotServer) SendAndClose(m *SnapshotResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *raftTransportSendSnapshotServer) Recv() (*SnapshotChunk, error) {
+	m := new(SnapshotChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, err
+	}
+	return m, nil
+}
+
+var _RaftTransport_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "raftgrpc.RaftTransport",
+	HandlerType: (*RaftTransportServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Send",
+			Handler:    _RaftTransport_Send_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _RaftTransport_Stream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SendSnapshot",
+			Handler:       _RaftTransport_SendSnapshot_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "rafttransport.proto",
+}
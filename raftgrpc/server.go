@@ -0,0 +1,150 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raftgrpc
+
+import (
+	"io"
+
+	"github.com/algoadv/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/algoadv/etcd/Godeps/_workspace/src/google.golang.org/grpc"
+	"github.com/algoadv/etcd/Godeps/_workspace/src/google.golang.org/grpc/codes"
+	"github.com/algoadv/etcd/pkg/types"
+	"github.com/algoadv/etcd/raft/raftpb"
+	"github.com/algoadv/etcd/rafthttp"
+)
+
+// peerGetter looks up the local peer object that should push messages
+// destined for id, mirroring rafthttp's peerGetter used by streamHandler.
+type peerGetter interface {
+	Get(id types.ID) *peer
+}
+
+// NewServer returns a RaftTransportServer that serves raft traffic on
+// behalf of r, attaching outgoing pushes via pg and saving received
+// snapshots with snapSaver. It is the gRPC counterpart of rafthttp's
+// handler, streamHandler and snapshotHandler combined.
+func NewServer(r rafthttp.Raft, pg peerGetter, snapSaver rafthttp.SnapshotSaver, id, cid types.ID) RaftTransportServer {
+	return &grpcServer{r: r, pg: pg, snapSaver: snapSaver, id: id, cid: cid}
+}
+
+type grpcServer struct {
+	r         rafthttp.Raft
+	pg        peerGetter
+	snapSaver rafthttp.SnapshotSaver
+	id        types.ID
+	cid       types.ID
+}
+
+// statuser lets Raft.Process return an error that carries its own gRPC
+// status, mirroring rafthttp's writerToResponse.
+type statuser interface {
+	Status() (codes.Code, string)
+}
+
+func (s *grpcServer) Send(ctx context.Context, m *raftpb.Message) (*SendResponse, error) {
+	if err := s.r.Process(ctx, *m); err != nil {
+		if se, ok := err.(statuser); ok {
+			c, msg := se.Status()
+			return nil, grpc.Errorf(c, msg)
+		}
+		plog.Warningf("failed to process raft message (%v)", err)
+		return nil, grpc.Errorf(codes.Internal, "error processing raft message")
+	}
+	return &SendResponse{}, nil
+}
+
+func (s *grpcServer) Stream(req *StreamRequest, stream RaftTransport_StreamServer) error {
+	from := types.ID(req.From)
+	if s.r.IsIDRemoved(uint64(from)) {
+		plog.Warningf("rejected the stream from peer %s since it was removed", from)
+		return grpc.Errorf(codes.FailedPrecondition, "removed member")
+	}
+	p := s.pg.Get(from)
+	if p == nil {
+		plog.Errorf("failed to find member %s in cluster %s", from, s.cid)
+		return grpc.Errorf(codes.NotFound, "sender not found")
+	}
+	if to := types.ID(req.To); to != s.id {
+		plog.Errorf("streaming request ignored (ID mismatch got %s want %s)", to, s.id)
+		return grpc.Errorf(codes.FailedPrecondition, "to field mismatch")
+	}
+
+	done := p.attachStream(stream)
+	defer p.detachStream(stream)
+	<-done
+	return nil
+}
+
+func (s *grpcServer) SendSnapshot(stream RaftTransport_SendSnapshotServer) error {
+	// The first chunk always carries the raft message envelope so we know
+	// the snapshot index before opening the file SaveFrom writes to.
+	first, err := stream.Recv()
+	if err != nil {
+		plog.Errorf("failed to receive snapshot chunk (%v)", err)
+		return grpc.Errorf(codes.Internal, "error receiving snapshot chunk")
+	}
+	var m raftpb.Message
+	if err := m.Unmarshal(first.Message); err != nil {
+		plog.Errorf("failed to unmarshal raft message (%v)", err)
+		return grpc.Errorf(codes.InvalidArgument, "error unmarshaling raft message")
+	}
+	if m.Type != raftpb.MsgSnap {
+		plog.Errorf("unexpected raft message type %s on snapshot path", m.Type)
+		return grpc.Errorf(codes.InvalidArgument, "wrong raft message type")
+	}
+
+	pr, pw := io.Pipe()
+	saveErrc := make(chan error, 1)
+	go func() { saveErrc <- s.snapSaver.SaveFrom(stream.Context(), pr, m.Snapshot.Metadata.Index) }()
+
+	var received uint64
+	chunk := first
+	for {
+		if len(chunk.Data) > 0 {
+			if _, err := pw.Write(chunk.Data); err != nil {
+				<-saveErrc
+				plog.Errorf("failed to save snapshot chunk (%v)", err)
+				return grpc.Errorf(codes.Internal, "error saving snapshot chunk")
+			}
+			received += uint64(len(chunk.Data))
+		}
+		if chunk.Last {
+			break
+		}
+		chunk, err = stream.Recv()
+		if err != nil {
+			pw.CloseWithError(err)
+			<-saveErrc
+			plog.Errorf("failed to receive snapshot chunk (%v)", err)
+			return grpc.Errorf(codes.Internal, "error receiving snapshot chunk")
+		}
+	}
+	pw.Close()
+	if err := <-saveErrc; err != nil {
+		plog.Errorf("failed to save KV snapshot (%v)", err)
+		return grpc.Errorf(codes.Internal, "error saving snapshot")
+	}
+	plog.Infof("received and saved snapshot [index: %d, from: %s] successfully", m.Snapshot.Metadata.Index, types.ID(m.From))
+
+	if err := s.r.Process(stream.Context(), m); err != nil {
+		if se, ok := err.(statuser); ok {
+			c, msg := se.Status()
+			return grpc.Errorf(c, msg)
+		}
+		plog.Warningf("failed to process raft message (%v)", err)
+		return grpc.Errorf(codes.Internal, "error processing raft message")
+	}
+	return stream.SendAndClose(&SnapshotResponse{BytesReceived: received})
+}
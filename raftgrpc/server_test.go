@@ -0,0 +1,127 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raftgrpc
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/algoadv/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/algoadv/etcd/Godeps/_workspace/src/google.golang.org/grpc/metadata"
+	"github.com/algoadv/etcd/pkg/types"
+	"github.com/algoadv/etcd/raft/raftpb"
+)
+
+type fakeRaft struct {
+	processed []raftpb.Message
+}
+
+func (f *fakeRaft) Process(ctx context.Context, m raftpb.Message) error {
+	f.processed = append(f.processed, m)
+	return nil
+}
+
+func (f *fakeRaft) IsIDRemoved(id uint64) bool { return false }
+
+type fakeSnapshotSaver struct {
+	ctx   context.Context
+	index uint64
+	data  []byte
+}
+
+func (f *fakeSnapshotSaver) SaveFrom(ctx context.Context, r io.Reader, index uint64) error {
+	f.ctx = ctx
+	f.index = index
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	f.data = b
+	return nil
+}
+
+type fakeSendSnapshotStream struct {
+	chunks []*SnapshotChunk
+	idx    int
+	resp   *SnapshotResponse
+}
+
+func (f *fakeSendSnapshotStream) Recv() (*SnapshotChunk, error) {
+	if f.idx >= len(f.chunks) {
+		return nil, io.EOF
+	}
+	c := f.chunks[f.idx]
+	f.idx++
+	return c, nil
+}
+
+func (f *fakeSendSnapshotStream) SendAndClose(r *SnapshotResponse) error {
+	f.resp = r
+	return nil
+}
+
+func (f *fakeSendSnapshotStream) SetHeader(metadata.MD) error  { return nil }
+func (f *fakeSendSnapshotStream) SendHeader(metadata.MD) error { return nil }
+func (f *fakeSendSnapshotStream) SetTrailer(metadata.MD)       {}
+func (f *fakeSendSnapshotStream) Context() context.Context     { return context.Background() }
+func (f *fakeSendSnapshotStream) SendMsg(m interface{}) error  { return nil }
+func (f *fakeSendSnapshotStream) RecvMsg(m interface{}) error  { return nil }
+
+func TestGRPCServerSendSnapshotChunking(t *testing.T) {
+	msg := raftpb.Message{
+		Type: raftpb.MsgSnap,
+		From: 2,
+		To:   1,
+		Snapshot: raftpb.Snapshot{
+			Metadata: raftpb.SnapshotMetadata{Index: 42},
+		},
+	}
+	envelope, err := msg.Marshal()
+	if err != nil {
+		t.Fatalf("failed to marshal envelope: %v", err)
+	}
+
+	payload := []byte("the quick brown fox jumps over the lazy dog")
+	stream := &fakeSendSnapshotStream{
+		chunks: []*SnapshotChunk{
+			{From: 2, To: 1, Message: envelope, Data: payload[:10]},
+			{From: 2, To: 1, Data: payload[10:25]},
+			{From: 2, To: 1, Data: payload[25:], Last: true},
+		},
+	}
+
+	raft := &fakeRaft{}
+	saver := &fakeSnapshotSaver{}
+	s := &grpcServer{r: raft, snapSaver: saver, id: types.ID(1), cid: types.ID(1)}
+
+	if err := s.SendSnapshot(stream); err != nil {
+		t.Fatalf("SendSnapshot returned error: %v", err)
+	}
+
+	if !bytes.Equal(saver.data, payload) {
+		t.Fatalf("snapshot data = %q, want %q", saver.data, payload)
+	}
+	if saver.index != 42 {
+		t.Fatalf("snapshot index = %d, want 42", saver.index)
+	}
+	if stream.resp == nil || stream.resp.BytesReceived != uint64(len(payload)) {
+		t.Fatalf("unexpected response: %+v", stream.resp)
+	}
+	if len(raft.processed) != 1 || raft.processed[0].Snapshot.Metadata.Index != 42 {
+		t.Fatalf("raft did not process the reassembled snapshot message: %+v", raft.processed)
+	}
+}
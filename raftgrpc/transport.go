@@ -0,0 +1,172 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package raftgrpc
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/algoadv/etcd/Godeps/_workspace/src/google.golang.org/grpc"
+	"github.com/algoadv/etcd/pkg/types"
+	"github.com/algoadv/etcd/raft/raftpb"
+	"github.com/algoadv/etcd/rafthttp"
+	"github.com/algoadv/etcd/snap"
+)
+
+var errMemberNotFound = errors.New("raftgrpc: member not found")
+
+// Transport is the gRPC counterpart of rafthttp.Transport: it shares its
+// AddPeer/RemovePeer/UpdatePeer surface so that EtcdServer can choose either
+// transport at startup, and in addition implements Send, SendSnapshot and
+// Stop, which rafthttp.Transport does not.
+type Transport struct {
+	ID        types.ID
+	ClusterID types.ID
+	Raft      rafthttp.Raft
+	SnapSaver rafthttp.SnapshotSaver
+
+	mu       sync.RWMutex
+	peers    map[types.ID]*peer
+	grpcSrv  *grpc.Server
+	listener net.Listener
+}
+
+// NewTransport builds a Transport ready to Start. It takes the same
+// arguments as rafthttp.NewTransport, so picking between the two at startup
+// is a matter of which constructor is called.
+func NewTransport(id, cid types.ID, r rafthttp.Raft, snapSaver rafthttp.SnapshotSaver) *Transport {
+	return &Transport{ID: id, ClusterID: cid, Raft: r, SnapSaver: snapSaver}
+}
+
+// Start begins serving incoming RaftTransport RPCs on l. Unlike
+// rafthttp.Transport, whose Handler() the caller mounts on its own mux,
+// raftgrpc owns the listener because a grpc.Server cannot share a plain
+// net/http mux.
+func (t *Transport) Start(l net.Listener) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.peers = make(map[types.ID]*peer)
+	t.listener = l
+
+	unary, stream := newClusterCompatibilityChecker(t.ClusterID)
+	t.grpcSrv = grpc.NewServer(
+		grpc.UnaryInterceptor(unary),
+		grpc.StreamInterceptor(stream),
+	)
+	RegisterRaftTransportServer(t.grpcSrv, NewServer(t.Raft, t, t.SnapSaver, t.ID, t.ClusterID))
+	go t.grpcSrv.Serve(l)
+	return nil
+}
+
+// Get implements the peerGetter interface used by grpcServer.Stream to
+// find the peer a remote's incoming Stream request should push to.
+func (t *Transport) Get(id types.ID) *peer {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.peers[id]
+}
+
+func (t *Transport) Send(ms []raftpb.Message) {
+	for _, m := range ms {
+		to := types.ID(m.To)
+		t.mu.RLock()
+		p, ok := t.peers[to]
+		t.mu.RUnlock()
+		if !ok {
+			plog.Debugf("ignored message %s (sender to %s not found)", m.Type, to)
+			continue
+		}
+		p.send(m)
+	}
+}
+
+func (t *Transport) SendSnapshot(m snap.Message) {
+	t.mu.RLock()
+	p, ok := t.peers[types.ID(m.To)]
+	t.mu.RUnlock()
+	if !ok {
+		m.CloseWithError(errMemberNotFound)
+		return
+	}
+	p.sendSnap(m)
+}
+
+func (t *Transport) AddPeer(id types.ID, us []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.peers[id]; ok {
+		return
+	}
+	t.peers[id] = startPeer(t, id, us)
+}
+
+func (t *Transport) RemovePeer(id types.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.peers[id]; ok {
+		p.stop()
+		delete(t.peers, id)
+	}
+}
+
+func (t *Transport) RemoveAllPeers() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, p := range t.peers {
+		p.stop()
+		delete(t.peers, id)
+	}
+}
+
+func (t *Transport) UpdatePeer(id types.ID, us []string) {
+	t.mu.RLock()
+	p, ok := t.peers[id]
+	t.mu.RUnlock()
+	if ok {
+		p.update(us)
+	}
+}
+
+func (t *Transport) ActiveSince(id types.ID) time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if p, ok := t.peers[id]; ok {
+		return p.activeSince()
+	}
+	return time.Time{}
+}
+
+func (t *Transport) ActivePeers() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	n := 0
+	for _, p := range t.peers {
+		if !p.activeSince().IsZero() {
+			n++
+		}
+	}
+	return n
+}
+
+func (t *Transport) Stop() {
+	t.RemoveAllPeers()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.grpcSrv != nil {
+		t.grpcSrv.Stop()
+	}
+}
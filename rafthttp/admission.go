@@ -0,0 +1,158 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rafthttp
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/algoadv/etcd/pkg/types"
+)
+
+const (
+	// DefaultMaxConcurrentProcess is the default number of raft messages
+	// from a single peer that may be handed to Raft.Process at once.
+	DefaultMaxConcurrentProcess = 16
+	// DefaultMaxQueueDepth bounds how many additional requests from a
+	// single peer may wait for a free admission slot before being shed
+	// with a 429.
+	DefaultMaxQueueDepth = 64
+	// DefaultMaxConcurrentSnapshots bounds how many snapshot receives may
+	// be in flight at once, to avoid disk thrashing.
+	DefaultMaxConcurrentSnapshots = 2
+
+	retryAfterSeconds = "1"
+)
+
+// AdmissionController bounds how many raft messages from each peer are
+// processed concurrently by handler and snapshotHandler, and sheds load by
+// rejecting a request once that peer's backlog exceeds maxQueueDepth,
+// instead of letting an unbounded number of blocked goroutines pile up
+// while the raft state machine falls behind.
+type AdmissionController struct {
+	maxConcurrent int
+	maxQueueDepth int
+
+	mu    sync.Mutex
+	peers map[types.ID]*peerAdmission
+}
+
+type peerAdmission struct {
+	sem    chan struct{}
+	queued int
+}
+
+// NewAdmissionController returns an AdmissionController that allows up to
+// maxConcurrent in-flight messages per peer, queuing up to maxQueueDepth
+// more before rejecting.
+func NewAdmissionController(maxConcurrent, maxQueueDepth int) *AdmissionController {
+	return &AdmissionController{
+		maxConcurrent: maxConcurrent,
+		maxQueueDepth: maxQueueDepth,
+		peers:         make(map[types.ID]*peerAdmission),
+	}
+}
+
+func (ac *AdmissionController) peerState(id types.ID) *peerAdmission {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	p, ok := ac.peers[id]
+	if !ok {
+		p = &peerAdmission{sem: make(chan struct{}, ac.maxConcurrent)}
+		ac.peers[id] = p
+	}
+	return p
+}
+
+// admit reserves a processing slot for a message from id, waiting if the
+// peer is already at maxConcurrent. It reports ok == false without waiting
+// if the peer's queue is already at maxQueueDepth, in which case the
+// caller should shed the request instead of admitting it.
+func (ac *AdmissionController) admit(id types.ID) (release func(), ok bool) {
+	p := ac.peerState(id)
+	label := id.String()
+
+	select {
+	case p.sem <- struct{}{}:
+		return func() { <-p.sem }, true
+	default:
+	}
+
+	ac.mu.Lock()
+	if p.queued >= ac.maxQueueDepth {
+		ac.mu.Unlock()
+		admissionRejected.WithLabelValues(label).Inc()
+		return nil, false
+	}
+	p.queued++
+	ac.mu.Unlock()
+	admissionQueueDepth.WithLabelValues(label).Inc()
+
+	start := time.Now()
+	p.sem <- struct{}{}
+	admissionQueueWaitSeconds.WithLabelValues(label).Observe(time.Since(start).Seconds())
+
+	ac.mu.Lock()
+	p.queued--
+	ac.mu.Unlock()
+	admissionQueueDepth.WithLabelValues(label).Dec()
+
+	return func() { <-p.sem }, true
+}
+
+// admitOrReject runs admit and, on rejection, writes a 429 with
+// Retry-After to w. It returns the release func and whether the caller may
+// proceed.
+func (ac *AdmissionController) admitOrReject(w http.ResponseWriter, id types.ID) (func(), bool) {
+	release, ok := ac.admit(id)
+	if !ok {
+		w.Header().Set("Retry-After", retryAfterSeconds)
+		http.Error(w, "raft message queue full", http.StatusTooManyRequests)
+	}
+	return release, ok
+}
+
+// snapshotAdmission bounds the number of snapshot receives in flight at
+// once, independent of which peer they come from, since the cost of a
+// snapshot receive is disk I/O rather than CPU.
+type snapshotAdmission struct {
+	sem chan struct{}
+}
+
+func newSnapshotAdmission(maxConcurrent int) *snapshotAdmission {
+	return &snapshotAdmission{sem: make(chan struct{}, maxConcurrent)}
+}
+
+func (sa *snapshotAdmission) tryAcquire() bool {
+	select {
+	case sa.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (sa *snapshotAdmission) release() { <-sa.sem }
+
+func (sa *snapshotAdmission) admitOrReject(w http.ResponseWriter, from types.ID) bool {
+	if sa.tryAcquire() {
+		return true
+	}
+	snapshotAdmissionRejected.WithLabelValues(from.String()).Inc()
+	w.Header().Set("Retry-After", retryAfterSeconds)
+	http.Error(w, "too many concurrent snapshot receives", http.StatusTooManyRequests)
+	return false
+}
@@ -0,0 +1,129 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rafthttp
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/algoadv/etcd/pkg/types"
+)
+
+func TestAdmissionControllerLimitsConcurrency(t *testing.T) {
+	ac := NewAdmissionController(2, 1)
+	id := types.ID(1)
+
+	release1, ok := ac.admit(id)
+	if !ok {
+		t.Fatal("expected first admit to succeed")
+	}
+	release2, ok := ac.admit(id)
+	if !ok {
+		t.Fatal("expected second admit to succeed")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		release3, ok := ac.admit(id)
+		if !ok {
+			t.Error("expected third admit to eventually succeed once a slot frees up")
+		} else {
+			release3()
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("third admit returned before a slot was released")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release1()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("third admit never unblocked after a slot was released")
+	}
+
+	release2()
+}
+
+func TestAdmissionControllerRejectsWhenQueueFull(t *testing.T) {
+	ac := NewAdmissionController(1, 1)
+	id := types.ID(1)
+
+	release, ok := ac.admit(id)
+	if !ok {
+		t.Fatal("expected first admit to succeed")
+	}
+
+	blocked := make(chan struct{})
+	go func() {
+		close(blocked)
+		if _, ok := ac.admit(id); !ok {
+			t.Error("expected the queued admit to eventually succeed")
+		}
+	}()
+	<-blocked
+	// Give the queued goroutine a chance to register itself before we
+	// check that a further admit is rejected.
+	time.Sleep(20 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	if _, ok := ac.admitOrReject(w, id); ok {
+		t.Fatal("expected admit to be rejected once the queue is full")
+	}
+	if w.Code != 429 {
+		t.Fatalf("status = %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("expected a Retry-After header on rejection")
+	}
+
+	release()
+}
+
+func TestAdmissionControllerPerPeerIsolation(t *testing.T) {
+	ac := NewAdmissionController(1, 0)
+	a, b := types.ID(1), types.ID(2)
+
+	releaseA, ok := ac.admit(a)
+	if !ok {
+		t.Fatal("expected admit for peer a to succeed")
+	}
+	defer releaseA()
+
+	if _, ok := ac.admit(b); !ok {
+		t.Fatal("peer b should not be blocked by peer a's admission state")
+	}
+}
+
+func TestSnapshotAdmissionBoundsConcurrency(t *testing.T) {
+	sa := newSnapshotAdmission(1)
+
+	if !sa.tryAcquire() {
+		t.Fatal("expected first acquire to succeed")
+	}
+	if sa.tryAcquire() {
+		t.Fatal("expected second acquire to fail while the first is held")
+	}
+	sa.release()
+	if !sa.tryAcquire() {
+		t.Fatal("expected acquire to succeed again after release")
+	}
+}
@@ -42,18 +42,28 @@ var (
 	errClusterIDMismatch   = errors.New("cluster ID mismatch")
 )
 
-func NewHandler(r Raft, cid types.ID) http.Handler {
+// NewHandler returns a handler that processes incoming raft messages for
+// r. ac admits messages per X-Server-From peer, shedding load with a 429
+// once a peer's backlog grows past its queue depth; a nil ac disables
+// admission control.
+func NewHandler(r Raft, cid types.ID, ac *AdmissionController) http.Handler {
 	return &handler{
 		r:   r,
 		cid: cid,
+		ac:  ac,
 	}
 }
 
-func newSnapshotHandler(r Raft, snapSaver SnapshotSaver, cid types.ID) http.Handler {
+// newSnapshotHandler returns a handler that receives and saves incoming
+// snapshots for r. In addition to ac, it enforces maxConcurrentSnapshots
+// concurrent receives so a burst of snapshot sends cannot thrash the disk.
+func newSnapshotHandler(r Raft, snapSaver SnapshotSaver, cid types.ID, ac *AdmissionController, maxConcurrentSnapshots int) http.Handler {
 	return &snapshotHandler{
 		r:         r,
 		snapSaver: snapSaver,
 		cid:       cid,
+		ac:        ac,
+		snapAC:    newSnapshotAdmission(maxConcurrentSnapshots),
 	}
 }
 
@@ -77,6 +87,7 @@ type writerToResponse interface {
 type handler struct {
 	r   Raft
 	cid types.ID
+	ac  *AdmissionController
 }
 
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -93,6 +104,15 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.ac != nil {
+		from, _ := types.IDFromString(r.Header.Get("X-Server-From"))
+		release, ok := h.ac.admitOrReject(w, from)
+		if !ok {
+			return
+		}
+		defer release()
+	}
+
 	// Limit the data size that could be read from the request body, which ensures that read from
 	// connection will not time out accidentally due to possible block in underlying implementation.
 	limitedr := pioutil.NewLimitedBufferReader(r.Body, ConnReadLimitByte)
@@ -127,6 +147,8 @@ type snapshotHandler struct {
 	r         Raft
 	snapSaver SnapshotSaver
 	cid       types.ID
+	ac        *AdmissionController
+	snapAC    *snapshotAdmission
 }
 
 // ServeHTTP serves HTTP request to receive and process snapshot message.
@@ -138,6 +160,12 @@ type snapshotHandler struct {
 // 1. snapshot messages sent through other TCP connections could still be
 // received and processed.
 // 2. this case should happen rarely, so no further optimization is done.
+// SaveFrom's context is canceled as soon as the connection closes, which
+// unblocks a SaveFrom stuck reading from a slow or dead sender. This net/http
+// predates Server.Shutdown (it relies on CloseNotifier), so the peer server
+// is stopped by closing its listener rather than graceful draining; that
+// abrupt stop is exactly the case this guards, since there is no in-flight
+// request draining here for the cancellation to race against.
 func (h *snapshotHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		w.Header().Set("Allow", "POST")
@@ -152,6 +180,26 @@ func (h *snapshotHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	from, _ := types.IDFromString(r.Header.Get("X-Server-From"))
+
+	// Admit on ac first: it can block for as long as the peer's queue wait,
+	// and snapAC's slots are scarce cluster-wide, so holding one idle while
+	// waiting on ac would starve other peers' snapshot sends behind
+	// unrelated message traffic from this peer.
+	if h.ac != nil {
+		release, ok := h.ac.admitOrReject(w, from)
+		if !ok {
+			return
+		}
+		defer release()
+	}
+	if h.snapAC != nil {
+		if !h.snapAC.admitOrReject(w, from) {
+			return
+		}
+		defer h.snapAC.release()
+	}
+
 	dec := &messageDecoder{r: r.Body}
 	m, err := dec.decode()
 	if err != nil {
@@ -166,8 +214,23 @@ func (h *snapshotHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// save snapshot
-	if err := h.snapSaver.SaveFrom(r.Body, m.Snapshot.Metadata.Index); err != nil {
+	// save snapshot; tie its context to the connection so a closed
+	// connection (e.g. during shutdown) unblocks a SaveFrom that is
+	// stuck reading from a slow or dead sender instead of leaking it.
+	ctx := context.Background()
+	if cn, ok := w.(http.CloseNotifier); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-cn.CloseNotify():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	if err := h.snapSaver.SaveFrom(ctx, r.Body, m.Snapshot.Metadata.Index); err != nil {
 		msg := fmt.Sprintf("failed to save KV snapshot (%v)", err)
 		plog.Error(msg)
 		http.Error(w, msg, http.StatusInternalServerError)
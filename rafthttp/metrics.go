@@ -0,0 +1,55 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rafthttp
+
+import "github.com/algoadv/etcd/Godeps/_workspace/src/github.com/prometheus/client_golang/prometheus"
+
+var (
+	admissionQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "rafthttp",
+		Name:      "admission_queue_depth",
+		Help:      "Number of incoming raft messages from a peer waiting for an admission slot.",
+	}, []string{"From"})
+
+	admissionQueueWaitSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "etcd",
+		Subsystem: "rafthttp",
+		Name:      "admission_queue_wait_seconds",
+		Help:      "Time an incoming raft message from a peer spent waiting for an admission slot.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"From"})
+
+	admissionRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "rafthttp",
+		Name:      "admission_rejected_total",
+		Help:      "Number of incoming raft messages rejected with 429 because a peer's admission queue was full.",
+	}, []string{"From"})
+
+	snapshotAdmissionRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "rafthttp",
+		Name:      "snapshot_admission_rejected_total",
+		Help:      "Number of incoming snapshots rejected with 429 because the concurrent snapshot receive limit was reached.",
+	}, []string{"From"})
+)
+
+func init() {
+	prometheus.MustRegister(admissionQueueDepth)
+	prometheus.MustRegister(admissionQueueWaitSeconds)
+	prometheus.MustRegister(admissionRejected)
+	prometheus.MustRegister(snapshotAdmissionRejected)
+}
@@ -0,0 +1,176 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rafthttp
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/algoadv/etcd/Godeps/_workspace/src/golang.org/x/net/context"
+	"github.com/algoadv/etcd/pkg/types"
+	"github.com/algoadv/etcd/raft/raftpb"
+)
+
+// Raft is the local raft node surface handler, snapshotHandler and
+// streamHandler drive to hand off decoded raft messages.
+type Raft interface {
+	Process(ctx context.Context, m raftpb.Message) error
+	IsIDRemoved(id uint64) bool
+}
+
+// SnapshotSaver persists a snapshot received over the wire. index is the
+// snapshot's raft index, used to name the saved file. ctx is canceled when
+// the underlying connection goes away (e.g. on shutdown), so a SaveFrom
+// blocked reading from a stalled or dead sender does not block it.
+type SnapshotSaver interface {
+	SaveFrom(ctx context.Context, r io.Reader, index uint64) error
+}
+
+// Peer is the outgoing sink newStreamHandler attaches an incoming stream
+// connection to. It is satisfied by Transport's own internal peer type; it
+// is declared here, rather than alongside the rest of the peer lifecycle,
+// only because peerGetter (http.go) needs a name for it.
+type Peer interface {
+	attachOutgoingConn(conn *outgoingConn)
+}
+
+// peer is Transport's minimal internal peer record: it tracks the URLs a
+// member was registered with and the most recently attached outgoing
+// connection, the way raftgrpc.peer tracks a dialed grpc.ClientConn. It
+// intentionally does not redial, round-robin across urls, or retry the way
+// the production streamWriter/pipeline machinery would; that full
+// Transporter surface (Send, peer lifecycle) is out of scope here, see
+// Transport's comment below.
+type peer struct {
+	id types.ID
+
+	mu   sync.Mutex
+	urls []string
+	conn *outgoingConn
+}
+
+func (p *peer) attachOutgoingConn(conn *outgoingConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.conn = conn
+}
+
+func (p *peer) update(us []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.urls = us
+}
+
+// Transport is the production construction site for rafthttp's
+// http.Handler: it owns the AdmissionController used by NewHandler and
+// newSnapshotHandler and wires them, together with newStreamHandler, onto
+// RaftPrefix/RaftStreamPrefix/RaftSnapshotPrefix. AddPeer/UpdatePeer take
+// peer URLs rather than a pre-built Peer, matching raftgrpc.Transport, so
+// EtcdServer can drive either transport through the same calls.
+//
+// It intentionally covers request admission, handler wiring and peer
+// bookkeeping only; the full Transporter surface (Send, pipeline/stream
+// writers, retry/backoff) belongs beside this in the production transport
+// and is out of scope here.
+type Transport struct {
+	ID        types.ID
+	ClusterID types.ID
+	Raft      Raft
+	SnapSaver SnapshotSaver
+
+	// AdmissionController bounds per-peer concurrency for both the plain
+	// message handler and the snapshot handler. If nil, Handler builds
+	// one from DefaultMaxConcurrentProcess/DefaultMaxQueueDepth.
+	AdmissionController *AdmissionController
+	// MaxConcurrentSnapshots bounds concurrent snapshot receives. If
+	// zero, Handler uses DefaultMaxConcurrentSnapshots.
+	MaxConcurrentSnapshots int
+
+	mu    sync.RWMutex
+	peers map[types.ID]*peer
+}
+
+// NewTransport returns a Transport ready to have its Handler mounted on the
+// member's peer-facing http.Server.
+func NewTransport(id, cid types.ID, r Raft, snapSaver SnapshotSaver) *Transport {
+	return &Transport{
+		ID:        id,
+		ClusterID: cid,
+		Raft:      r,
+		SnapSaver: snapSaver,
+		peers:     make(map[types.ID]*peer),
+	}
+}
+
+// Get implements peerGetter for newStreamHandler.
+func (t *Transport) Get(id types.ID) Peer {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	p, ok := t.peers[id]
+	if !ok {
+		return nil
+	}
+	return p
+}
+
+// AddPeer registers a peer reachable at us as the outgoing sink for
+// messages to id, building the internal peer record itself rather than
+// taking a pre-built Peer.
+func (t *Transport) AddPeer(id types.ID, us []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.peers[id]; ok {
+		return
+	}
+	t.peers[id] = &peer{id: id, urls: us}
+}
+
+// RemovePeer unregisters the peer for id.
+func (t *Transport) RemovePeer(id types.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.peers, id)
+}
+
+// UpdatePeer updates the URLs the peer for id is reachable at.
+func (t *Transport) UpdatePeer(id types.ID, us []string) {
+	t.mu.RLock()
+	p, ok := t.peers[id]
+	t.mu.RUnlock()
+	if ok {
+		p.update(us)
+	}
+}
+
+// Handler builds the http.Handler to mount for RaftPrefix, RaftStreamPrefix
+// and RaftSnapshotPrefix, constructing a default AdmissionController and
+// snapshot concurrency limit when none were configured.
+func (t *Transport) Handler() http.Handler {
+	ac := t.AdmissionController
+	if ac == nil {
+		ac = NewAdmissionController(DefaultMaxConcurrentProcess, DefaultMaxQueueDepth)
+	}
+	maxSnaps := t.MaxConcurrentSnapshots
+	if maxSnaps <= 0 {
+		maxSnaps = DefaultMaxConcurrentSnapshots
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(RaftPrefix, NewHandler(t.Raft, t.ClusterID, ac))
+	mux.Handle(RaftStreamPrefix+"/", newStreamHandler(t, t.Raft, t.ID, t.ClusterID))
+	mux.Handle(RaftSnapshotPrefix, newSnapshotHandler(t.Raft, t.SnapSaver, t.ClusterID, ac, maxSnaps))
+	return mux
+}